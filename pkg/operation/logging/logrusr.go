@@ -0,0 +1,84 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides a logr.Logger adapter backed by logrus, so that callers who have not yet
+// migrated off *logrus.Logger can keep passing it into the logr-based helpers in pkg/operation.
+package logging
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/sirupsen/logrus"
+)
+
+// NewLogrusLogger wraps the given logrus.FieldLogger as a logr.Logger. logr's V(level) is mapped onto
+// logrus' Debug (level > 0) and Info (level == 0); Error always logs at logrus' Error level. Structured
+// key/value pairs passed to Info/Error/WithValues are attached via logrus.Fields.
+func NewLogrusLogger(log logrus.FieldLogger) logr.Logger {
+	return logr.New(&logrusSink{log: log})
+}
+
+type logrusSink struct {
+	log   logrus.FieldLogger
+	name  string
+	level int
+}
+
+var _ logr.LogSink = &logrusSink{}
+
+func (l *logrusSink) Init(info logr.RuntimeInfo) {}
+
+func (l *logrusSink) Enabled(level int) bool { return true }
+
+func (l *logrusSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	entry := l.log.WithFields(fields(l.name, keysAndValues))
+	if level > 0 {
+		entry.Debug(msg)
+		return
+	}
+	entry.Info(msg)
+}
+
+func (l *logrusSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.log.WithFields(fields(l.name, keysAndValues)).WithError(err).Error(msg)
+}
+
+func (l *logrusSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &logrusSink{
+		log:   l.log.WithFields(fields("", keysAndValues)),
+		name:  l.name,
+		level: l.level,
+	}
+}
+
+func (l *logrusSink) WithName(name string) logr.LogSink {
+	newName := name
+	if l.name != "" {
+		newName = l.name + "." + name
+	}
+	return &logrusSink{log: l.log, name: newName, level: l.level}
+}
+
+func fields(name string, keysAndValues []interface{}) logrus.Fields {
+	result := make(logrus.Fields, len(keysAndValues)/2+1)
+	if name != "" {
+		result["logger"] = name
+	}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key := fmt.Sprintf("%v", keysAndValues[i])
+		result[key] = keysAndValues[i+1]
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operation
+
+import (
+	"context"
+	"time"
+
+	"github.com/gardener/gardener-extension-provider-azure/pkg/operation/statereporter"
+)
+
+const (
+	// DefaultOverallTimeout is the default budget for an entire helper invocation (e.g. scaling a
+	// deployment and waiting for it to come up), used when no WithOverallTimeout option is given.
+	DefaultOverallTimeout = 5 * time.Minute
+	// DefaultAttemptTimeout is the default budget for a single attempt/API call within a helper
+	// invocation, used when no WithAttemptTimeout option is given.
+	DefaultAttemptTimeout = 30 * time.Second
+	// DumpOnFailureTimeout bounds the extra snapshot taken by dumpOnFailure. It is applied to a context
+	// derived from context.Background() rather than the helper's overall context, since dumpOnFailure is only
+	// ever invoked from that context's Done() branch, i.e. once it has, by definition, already expired.
+	DumpOnFailureTimeout = 10 * time.Second
+)
+
+// Options bundles the timeout budgeting shared by the helpers in this package, so that a single stuck API
+// call times out on its own without being able to consume the entire overall budget.
+type Options struct {
+	overallTimeout time.Duration
+	attemptTimeout time.Duration
+	stateReporter  *statereporter.Reporter
+}
+
+// Option configures an Options struct.
+type Option func(*Options)
+
+// WithOverallTimeout sets the overall deadline for a helper invocation.
+func WithOverallTimeout(d time.Duration) Option {
+	return func(o *Options) { o.overallTimeout = d }
+}
+
+// WithAttemptTimeout sets the deadline applied to each individual attempt/API call within a helper
+// invocation.
+func WithAttemptTimeout(d time.Duration) Option {
+	return func(o *Options) { o.attemptTimeout = d }
+}
+
+// WithStateReporter attaches a statereporter.Reporter that gets an extra, out-of-band snapshot whenever a
+// wait helper in this package times out, so the failure has a reproducible record of the last observed
+// state. Other failures (e.g. an out-of-order transition) do not trigger a snapshot.
+func WithStateReporter(r *statereporter.Reporter) Option {
+	return func(o *Options) { o.stateReporter = r }
+}
+
+// NewOptions builds an Options struct with the package defaults, applying the given functional options on
+// top.
+func NewOptions(opts ...Option) *Options {
+	o := &Options{
+		overallTimeout: DefaultOverallTimeout,
+		attemptTimeout: DefaultAttemptTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// overallContext derives a context bounded by the overall timeout from ctx.
+func (o *Options) overallContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, o.overallTimeout)
+}
+
+// attemptContext derives a context bounded by the per-attempt timeout from ctx.
+func (o *Options) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, o.attemptTimeout)
+}
+
+// dumpOnFailure takes one extra state snapshot if a reporter is configured, best-effort, so a wait
+// helper's failure has a reproducible record of the last observed state without having to wait for the
+// reporter's regular interval. It is only ever called once the helper's overall context has already
+// expired, so it derives a fresh, short-lived context from context.Background() instead of reusing it.
+func (o *Options) dumpOnFailure() {
+	if o == nil || o.stateReporter == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DumpOnFailureTimeout)
+	defer cancel()
+	_ = o.stateReporter.DumpOnFailure(ctx)
+}
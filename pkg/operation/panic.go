@@ -0,0 +1,50 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operation
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/gardener/gardener/pkg/utils/retry"
+	"github.com/go-logr/logr"
+)
+
+// safeRun wraps a retry.Until-style retry body so that a panic inside fn (e.g. a nil dereference caused by
+// a malformed extension resource) doesn't take down the whole integration test binary. The panic, along
+// with its stack trace, is converted into a retry.SevereError so the caller's retry.Until stops retrying
+// and surfaces it like any other unrecoverable error.
+func safeRun(fn func(ctx context.Context) (bool, error)) func(ctx context.Context) (bool, error) {
+	return func(ctx context.Context) (done bool, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				done, err = retry.SevereError(fmt.Errorf("recovered from panic in retry attempt: %v\n%s", r, debug.Stack()))
+			}
+		}()
+		return fn(ctx)
+	}
+}
+
+// safeCheck runs fn, a cache event-handler callback, recovering and logging any panic instead of letting it
+// crash the informer's event delivery goroutine.
+func safeCheck(log logr.Logger, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(fmt.Errorf("%v", r), "recovered from panic while evaluating extension condition", "stack", string(debug.Stack()))
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package operation bundles helpers used by the Azure provider's integration and e2e tests to
+// observe and manipulate resources on the seed while a Shoot reconciliation is in flight.
+package operation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	gardencorev1beta1 "github.com/gardener/gardener/pkg/apis/core/v1beta1"
+	"github.com/gardener/gardener/pkg/client/kubernetes"
+	kutil "github.com/gardener/gardener/pkg/utils/kubernetes"
+	gardenertest "github.com/gardener/gardener/test/integration/framework"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WaitForExtensionCondition waits until the extension identified by groupVersionKind and namespacedName
+// reports the given condition type, status and reason, or until the overall timeout elapses. Instead of
+// polling the seed, it registers a watch on the extension's GVK via the provided cache and is notified of
+// updates as they happen, falling back to an initial Get from the cache so that a condition which is already
+// met before the watch is established is not missed. If opts carries a state reporter (see WithStateReporter),
+// it is asked for one extra snapshot when the wait times out. opts budgets the overall wait as well as the
+// informer setup and initial Get; pass nil to use the package defaults (see NewOptions).
+func WaitForExtensionCondition(ctx context.Context, log logr.Logger, opts *Options, seedCache cache.Cache, groupVersionKind schema.GroupVersionKind, namespacedName types.NamespacedName, conditionType gardencorev1beta1.ConditionType, conditionStatus gardencorev1beta1.ConditionStatus, conditionReason string) error {
+	log = log.WithValues("namespace", namespacedName.Namespace, "name", namespacedName.Name, "kind", groupVersionKind.Kind, "conditionType", conditionType, "conditionStatus", conditionStatus, "conditionReason", conditionReason)
+	if opts == nil {
+		opts = NewOptions()
+	}
+
+	overallCtx, cancelOverall := opts.overallContext(ctx)
+	defer cancelOverall()
+
+	attemptCtx, cancelAttempt := opts.attemptContext(overallCtx)
+	informer, err := seedCache.GetInformerForKind(attemptCtx, groupVersionKind)
+	cancelAttempt()
+	if err != nil {
+		return fmt.Errorf("unable to get informer for kind %s: %w", groupVersionKind.Kind, err)
+	}
+
+	var (
+		done     = make(chan struct{})
+		closeErr error
+		closeOne sync.Once
+	)
+	closeDone := func(err error) {
+		closeOne.Do(func() {
+			closeErr = err
+			close(done)
+		})
+	}
+
+	check := func(obj interface{}) {
+		safeCheck(log, func() {
+			rawExtension, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			if rawExtension.GetNamespace() != namespacedName.Namespace || rawExtension.GetName() != namespacedName.Name {
+				return
+			}
+
+			met, err := extensionHasCondition(rawExtension, groupVersionKind, conditionType, conditionStatus, conditionReason)
+			if err != nil {
+				log.V(1).Info("unable to evaluate condition on extension", "err", err)
+				return
+			}
+			if met {
+				log.V(0).Info("condition met")
+				closeDone(nil)
+				return
+			}
+			log.V(1).Info("condition not met")
+		})
+	}
+
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    check,
+		UpdateFunc: func(_, newObj interface{}) { check(newObj) },
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add event handler for kind %s: %w", groupVersionKind.Kind, err)
+	}
+	defer func() {
+		_ = informer.RemoveEventHandler(registration)
+	}()
+
+	// The extension might already satisfy the condition before our handler was registered, so do one
+	// initial check against the cache's current state to avoid waiting for an update that never comes.
+	attemptCtx, cancelAttempt = opts.attemptContext(overallCtx)
+	rawExtension := &unstructured.Unstructured{}
+	rawExtension.SetGroupVersionKind(groupVersionKind)
+	getErr := seedCache.Get(attemptCtx, namespacedName, rawExtension)
+	cancelAttempt()
+	if getErr != nil && !apierrors.IsNotFound(getErr) {
+		return fmt.Errorf("unable to retrieve extension from seed (ns: %s, name: %s, kind %s): %w", namespacedName.Namespace, namespacedName.Name, groupVersionKind.Kind, getErr)
+	} else if getErr == nil {
+		check(rawExtension)
+	}
+
+	select {
+	case <-done:
+		return closeErr
+	case <-overallCtx.Done():
+		log.V(0).Info("condition not met before context was done", "err", overallCtx.Err())
+		opts.dumpOnFailure()
+		return fmt.Errorf("extension (ns: %s, name: %s, kind %s) did not reach expected condition (conditionType: %s, conditionStatus: %s, conditionReason: %s): %w", namespacedName.Namespace, namespacedName.Name, groupVersionKind.Kind, conditionType, conditionStatus, conditionReason, overallCtx.Err())
+	}
+}
+
+// WaitForExtensionConditionWithClient is a variant of WaitForExtensionCondition for callers that only have
+// a client.WithWatch at hand rather than a running cache.Cache (e.g. a short-lived test helper that doesn't
+// otherwise need one). Since building a cache.Cache requires a *rest.Config we don't have here, it instead
+// drives its own toolscache.Controller off seedClient's own List/Watch directly, and tears it down again
+// once the condition is met or the overall timeout elapses.
+func WaitForExtensionConditionWithClient(ctx context.Context, log logr.Logger, opts *Options, seedClient client.WithWatch, groupVersionKind schema.GroupVersionKind, namespacedName types.NamespacedName, conditionType gardencorev1beta1.ConditionType, conditionStatus gardencorev1beta1.ConditionStatus, conditionReason string) error {
+	log = log.WithValues("namespace", namespacedName.Namespace, "name", namespacedName.Name, "kind", groupVersionKind.Kind, "conditionType", conditionType, "conditionStatus", conditionStatus, "conditionReason", conditionReason)
+	if opts == nil {
+		opts = NewOptions()
+	}
+
+	overallCtx, cancelOverall := opts.overallContext(ctx)
+	defer cancelOverall()
+
+	listGroupVersionKind := schema.GroupVersionKind{Group: groupVersionKind.Group, Version: groupVersionKind.Version, Kind: groupVersionKind.Kind + "List"}
+	listWatch := &toolscache.ListWatch{
+		ListFunc: func(_ metav1.ListOptions) (runtime.Object, error) {
+			attemptCtx, cancelAttempt := opts.attemptContext(overallCtx)
+			defer cancelAttempt()
+
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(listGroupVersionKind)
+			if err := seedClient.List(attemptCtx, list, client.InNamespace(namespacedName.Namespace)); err != nil {
+				return nil, err
+			}
+			return list, nil
+		},
+		WatchFunc: func(_ metav1.ListOptions) (watch.Interface, error) {
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(listGroupVersionKind)
+			return seedClient.Watch(overallCtx, list, client.InNamespace(namespacedName.Namespace))
+		},
+	}
+
+	var (
+		done     = make(chan struct{})
+		closeErr error
+		closeOne sync.Once
+	)
+	closeDone := func(err error) {
+		closeOne.Do(func() {
+			closeErr = err
+			close(done)
+		})
+	}
+
+	check := func(obj interface{}) {
+		safeCheck(log, func() {
+			rawExtension, ok := obj.(*unstructured.Unstructured)
+			if !ok || rawExtension.GetName() != namespacedName.Name {
+				return
+			}
+
+			met, err := extensionHasCondition(rawExtension, groupVersionKind, conditionType, conditionStatus, conditionReason)
+			if err != nil {
+				log.V(1).Info("unable to evaluate condition on extension", "err", err)
+				return
+			}
+			if met {
+				log.V(0).Info("condition met")
+				closeDone(nil)
+			}
+		})
+	}
+
+	_, controller := toolscache.NewInformer(listWatch, &unstructured.Unstructured{}, 0, toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    check,
+		UpdateFunc: func(_, newObj interface{}) { check(newObj) },
+	})
+
+	controllerCtx, cancelController := context.WithCancel(overallCtx)
+	defer cancelController()
+	go controller.Run(controllerCtx.Done())
+
+	select {
+	case <-done:
+		return closeErr
+	case <-overallCtx.Done():
+		log.V(0).Info("condition not met before context was done", "err", overallCtx.Err())
+		opts.dumpOnFailure()
+		return fmt.Errorf("extension (ns: %s, name: %s, kind %s) did not reach expected condition (conditionType: %s, conditionStatus: %s, conditionReason: %s): %w", namespacedName.Namespace, namespacedName.Name, groupVersionKind.Kind, conditionType, conditionStatus, conditionReason, overallCtx.Err())
+	}
+}
+
+// extensionHasCondition reports whether the given unstructured extension resource currently has the
+// expected condition type, status and reason set.
+func extensionHasCondition(rawExtension *unstructured.Unstructured, groupVersionKind schema.GroupVersionKind, conditionType gardencorev1beta1.ConditionType, conditionStatus gardencorev1beta1.ConditionStatus, conditionReason string) (bool, error) {
+	condition, ok, err := extensionCondition(rawExtension, conditionType)
+	if err != nil || !ok {
+		return false, err
+	}
+	return condition.Status == conditionStatus && condition.Reason == conditionReason, nil
+}
+
+// ScaleDeployment scales a deployment to the desired replica count, waiting for the scale to take effect.
+// opts budgets the overall call, and the per-attempt timeout bounds the replica lookup and the scale call;
+// the wait for the scale to take effect is bounded by the overall timeout only. Pass nil to use the package
+// defaults (see NewOptions).
+func ScaleDeployment(ctx context.Context, opts *Options, cl client.Client, desiredReplicas *int32, name, namespace string) (*int32, error) {
+	if desiredReplicas == nil {
+		return nil, nil
+	}
+	if opts == nil {
+		opts = NewOptions()
+	}
+
+	overallCtx, cancelOverall := opts.overallContext(ctx)
+	defer cancelOverall()
+
+	attemptCtx, cancelAttempt := opts.attemptContext(overallCtx)
+	replicas, err := gardenertest.GetDeploymentReplicas(attemptCtx, cl, namespace, name)
+	cancelAttempt()
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the replica count of the %s deployment: '%v'", name, err)
+	}
+	if replicas == nil || *replicas == *desiredReplicas {
+		return nil, nil
+	}
+
+	// scale the deployment
+	attemptCtx, cancelAttempt = opts.attemptContext(overallCtx)
+	err = kubernetes.ScaleDeployment(attemptCtx, cl, kutil.Key(namespace, name), *desiredReplicas)
+	cancelAttempt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scale the replica count of the %s deployment: '%v'", name, err)
+	}
+
+	// wait until scaled, guarding against a panic bubbling out of the underlying retry body
+	if _, err := safeRun(func(ctx context.Context) (bool, error) {
+		return true, gardenertest.WaitUntilDeploymentScaled(ctx, cl, namespace, name, *desiredReplicas)
+	})(overallCtx); err != nil {
+		return nil, fmt.Errorf("failed to wait until the %s deployment is scaled: '%v'", name, err)
+	}
+	return replicas, nil
+}
+
+// ScaleGardenerResourceManager scales the gardener-resource-manager to the desired replicas. See
+// ScaleDeployment for the meaning of opts.
+func ScaleGardenerResourceManager(ctx context.Context, opts *Options, namespace string, cl client.Client, desiredReplicas *int32) (*int32, error) {
+	return ScaleDeployment(ctx, opts, cl, desiredReplicas, "gardener-resource-manager", namespace)
+}
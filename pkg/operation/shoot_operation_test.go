@@ -0,0 +1,115 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gardencorev1beta1 "github.com/gardener/gardener/pkg/apis/core/v1beta1"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var withClientTestGVK = schema.GroupVersionKind{Group: "extensions.gardener.cloud", Version: "v1alpha1", Kind: "Infrastructure"}
+
+func newWithClientScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	listGVK := schema.GroupVersionKind{Group: withClientTestGVK.Group, Version: withClientTestGVK.Version, Kind: withClientTestGVK.Kind + "List"}
+	scheme.AddKnownTypeWithName(withClientTestGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(listGVK, &unstructured.UnstructuredList{})
+	return scheme
+}
+
+func newWithClientTestExtension(namespacedName types.NamespacedName, status gardencorev1beta1.ConditionStatus, reason string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(withClientTestGVK)
+	obj.SetName(namespacedName.Name)
+	obj.SetNamespace(namespacedName.Namespace)
+	if err := unstructured.SetNestedSlice(obj.Object, []interface{}{
+		map[string]interface{}{
+			"type":   "Healthy",
+			"status": string(status),
+			"reason": reason,
+		},
+	}, "status", "conditions"); err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+// TestWaitForExtensionConditionWithClient_AlreadyMet exercises the initial List performed against
+// seedClient itself, confirming the wait observes the seed the caller passed in.
+func TestWaitForExtensionConditionWithClient_AlreadyMet(t *testing.T) {
+	namespacedName := types.NamespacedName{Namespace: "test", Name: "infra"}
+	seedClient := fake.NewClientBuilder().
+		WithScheme(newWithClientScheme()).
+		WithObjects(newWithClientTestExtension(namespacedName, gardencorev1beta1.ConditionTrue, "Reconciled")).
+		Build()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := WaitForExtensionConditionWithClient(ctx, logr.Discard(), nil, seedClient, withClientTestGVK, namespacedName, "Healthy", gardencorev1beta1.ConditionTrue, "Reconciled"); err != nil {
+		t.Fatalf("expected the already-satisfied condition to be observed, got: %v", err)
+	}
+}
+
+// TestWaitForExtensionConditionWithClient_ObservesWatchEvent exercises the watch registered against
+// seedClient.Watch, confirming updates are actually observed rather than the wait stalling (or erroring
+// immediately) because it was never watching the right cluster.
+func TestWaitForExtensionConditionWithClient_ObservesWatchEvent(t *testing.T) {
+	namespacedName := types.NamespacedName{Namespace: "test", Name: "infra"}
+	seedClient := fake.NewClientBuilder().
+		WithScheme(newWithClientScheme()).
+		WithObjects(newWithClientTestExtension(namespacedName, gardencorev1beta1.ConditionFalse, "Reconciling")).
+		Build()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- WaitForExtensionConditionWithClient(ctx, logr.Discard(), nil, seedClient, withClientTestGVK, namespacedName, "Healthy", gardencorev1beta1.ConditionTrue, "Reconciled")
+	}()
+
+	// give WaitForExtensionConditionWithClient a moment to register its watch before updating the extension.
+	time.Sleep(50 * time.Millisecond)
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(withClientTestGVK)
+	if err := seedClient.Get(context.Background(), namespacedName, current); err != nil {
+		t.Fatalf("unable to fetch test extension: %v", err)
+	}
+	updated := newWithClientTestExtension(namespacedName, gardencorev1beta1.ConditionTrue, "Reconciled")
+	updated.SetResourceVersion(current.GetResourceVersion())
+	if err := seedClient.Update(context.Background(), updated); err != nil {
+		t.Fatalf("unable to update test extension: %v", err)
+	}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("expected the watched condition update to be observed, got: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for WaitForExtensionConditionWithClient to observe the update")
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statereporter periodically snapshots the Azure-owned extension resources in a Shoot's
+// control-plane namespace on the seed and writes timestamped artifacts to disk, so that a failing
+// integration or e2e test has a reproducible record of how the resources evolved leading up to the
+// failure. Capture is opt-in: a caller constructs a Reporter with New and passes it to the pkg/operation
+// wait helpers via operation.WithStateReporter, or registers it as a manager.Runnable itself. No Reporter is
+// wired in by default, so callers that want failure snapshots have to ask for one explicitly.
+package statereporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener/pkg/api/extensions"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// defaultResourceKinds are the extension GVKs the reporter snapshots by default, alongside the
+// gardener-resource-manager Deployment and the provider secrets. Callers can override this via
+// WithResourceKinds.
+var defaultResourceKinds = []schema.GroupVersionKind{
+	{Group: "extensions.gardener.cloud", Version: "v1alpha1", Kind: "Infrastructure"},
+	{Group: "extensions.gardener.cloud", Version: "v1alpha1", Kind: "ControlPlane"},
+	{Group: "extensions.gardener.cloud", Version: "v1alpha1", Kind: "Worker"},
+	{Group: "extensions.gardener.cloud", Version: "v1alpha1", Kind: "BackupBucket"},
+	{Group: "extensions.gardener.cloud", Version: "v1alpha1", Kind: "BackupEntry"},
+}
+
+// resourceManagerDeploymentName is the Deployment that ScaleGardenerResourceManager scales.
+const resourceManagerDeploymentName = "gardener-resource-manager"
+
+// azureProviderSecretLabel is set on the secrets generated by the azure.provider.extensions.gardener.cloud
+// controllers (e.g. the cloud provider credentials and generated CA/TLS secrets), so the reporter can pick
+// them up without having to know their exact names.
+const azureProviderSecretLabel = "provider.extensions.gardener.cloud/type"
+
+// azureProviderSecretLabelValue is the expected value of azureProviderSecretLabel for Azure.
+const azureProviderSecretLabelValue = "azure"
+
+// ResourceSnapshot is the observed state of a single namespaced resource at the time of a snapshot.
+type ResourceSnapshot struct {
+	Kind               string              `json:"kind"`
+	Name               string              `json:"name"`
+	Conditions         []ConditionSnapshot `json:"conditions,omitempty"`
+	LastOperationState string              `json:"lastOperationState,omitempty"`
+	Replicas           *int32              `json:"replicas,omitempty"`
+	Generation         int64               `json:"generation"`
+	ObservedGeneration int64               `json:"observedGeneration"`
+}
+
+// ConditionSnapshot is the observed state of a single condition at the time of a snapshot.
+type ConditionSnapshot struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// Snapshot is the full set of observed resources in a Shoot's control-plane namespace at a point in time.
+type Snapshot struct {
+	Timestamp time.Time                   `json:"timestamp"`
+	Namespace string                      `json:"namespace"`
+	Resources map[string]ResourceSnapshot `json:"resources"`
+}
+
+// Reporter periodically snapshots the Azure-owned extension resources of a Shoot's control-plane
+// namespace and writes them, alongside a compact changelog of what changed since the previous snapshot, to
+// outDir. It implements manager.Runnable so it can be registered with a controller-runtime manager.
+type Reporter struct {
+	client    client.Client
+	log       logr.Logger
+	namespace string
+	outDir    string
+	interval  time.Duration
+	kinds     []schema.GroupVersionKind
+
+	previousMu sync.Mutex
+	previous   *Snapshot
+}
+
+// Option configures a Reporter.
+type Option func(*Reporter)
+
+// WithInterval overrides the default snapshot interval of 30 seconds.
+func WithInterval(d time.Duration) Option {
+	return func(r *Reporter) { r.interval = d }
+}
+
+// WithResourceKinds overrides the default set of extension GVKs that get snapshotted.
+func WithResourceKinds(kinds []schema.GroupVersionKind) Option {
+	return func(r *Reporter) { r.kinds = kinds }
+}
+
+// New creates a Reporter that snapshots the given Shoot control-plane namespace via cl, writing artifacts
+// to outDir. New does not touch the filesystem; outDir is created by Start and before each snapshot if it
+// does not already exist.
+func New(cl client.Client, log logr.Logger, namespace, outDir string, opts ...Option) *Reporter {
+	r := &Reporter{
+		client:    cl,
+		log:       log.WithValues("namespace", namespace),
+		namespace: namespace,
+		outDir:    outDir,
+		interval:  30 * time.Second,
+		kinds:     defaultResourceKinds,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+var _ manager.Runnable = &Reporter{}
+
+// Start runs the reporter until ctx is done, taking a snapshot every interval. No snapshot is taken when
+// ctx is done; use DumpOnFailure for an extra one.
+func (r *Reporter) Start(ctx context.Context) error {
+	if err := os.MkdirAll(r.outDir, 0o755); err != nil {
+		return fmt.Errorf("unable to create state reporter output directory %q: %w", r.outDir, err)
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.snapshotOnce(ctx); err != nil {
+				r.log.V(1).Info("failed to take snapshot", "err", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// DumpOnFailure takes one final snapshot outside of the regular interval, intended to be called by test
+// helpers right after a wait failed so the last observed state is captured even if the next tick would
+// otherwise never fire.
+func (r *Reporter) DumpOnFailure(ctx context.Context) error {
+	return r.snapshotOnce(ctx)
+}
+
+func (r *Reporter) snapshotOnce(ctx context.Context) error {
+	if err := os.MkdirAll(r.outDir, 0o755); err != nil {
+		return fmt.Errorf("unable to create state reporter output directory %q: %w", r.outDir, err)
+	}
+
+	snapshot := Snapshot{
+		Timestamp: time.Now(),
+		Namespace: r.namespace,
+		Resources: map[string]ResourceSnapshot{},
+	}
+
+	for _, gvk := range r.kinds {
+		list := unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(schema.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind + "List"})
+		if err := r.client.List(ctx, &list, client.InNamespace(r.namespace)); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("unable to list %s in namespace %s: %w", gvk.Kind, r.namespace, err)
+		}
+
+		for i := range list.Items {
+			resourceSnapshot, err := resourceSnapshotFromExtension(&list.Items[i])
+			if err != nil {
+				r.log.V(1).Info("unable to snapshot extension resource", "kind", gvk.Kind, "name", list.Items[i].GetName(), "err", err)
+				continue
+			}
+			snapshot.Resources[snapshotKey(gvk.Kind, list.Items[i].GetName())] = resourceSnapshot
+		}
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := r.client.List(ctx, secrets, client.InNamespace(r.namespace), client.MatchingLabels{azureProviderSecretLabel: azureProviderSecretLabelValue}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to list provider secrets in namespace %s: %w", r.namespace, err)
+		}
+	} else {
+		for i := range secrets.Items {
+			secret := &secrets.Items[i]
+			snapshot.Resources[snapshotKey("Secret", secret.Name)] = ResourceSnapshot{
+				Kind:               "Secret",
+				Name:               secret.Name,
+				Generation:         secret.Generation,
+				ObservedGeneration: secret.Generation,
+			}
+		}
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := r.client.Get(ctx, client.ObjectKey{Namespace: r.namespace, Name: resourceManagerDeploymentName}, deployment); err == nil {
+		snapshot.Resources[snapshotKey("Deployment", resourceManagerDeploymentName)] = ResourceSnapshot{
+			Kind:               "Deployment",
+			Name:               resourceManagerDeploymentName,
+			Replicas:           deployment.Spec.Replicas,
+			Generation:         deployment.Generation,
+			ObservedGeneration: deployment.Status.ObservedGeneration,
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to get %s deployment: %w", resourceManagerDeploymentName, err)
+	}
+
+	r.previousMu.Lock()
+	defer r.previousMu.Unlock()
+
+	changelog := diff(r.previous, &snapshot)
+	if err := r.writeArtifact(snapshot, changelog); err != nil {
+		return err
+	}
+	r.previous = &snapshot
+	return nil
+}
+
+// resourceSnapshotFromExtension extracts the fields we care about from an unstructured extension resource
+// via the generic extensions.Accessor used throughout gardener.
+func resourceSnapshotFromExtension(obj *unstructured.Unstructured) (ResourceSnapshot, error) {
+	acc, err := extensions.Accessor(obj.DeepCopyObject())
+	if err != nil {
+		return ResourceSnapshot{}, err
+	}
+
+	snapshot := ResourceSnapshot{
+		Kind:               obj.GetKind(),
+		Name:               obj.GetName(),
+		Generation:         obj.GetGeneration(),
+		ObservedGeneration: acc.GetExtensionStatus().GetObservedGeneration(),
+	}
+	if lastOp := acc.GetExtensionStatus().GetLastOperation(); lastOp != nil {
+		snapshot.LastOperationState = string(lastOp.State)
+	}
+	for _, condition := range acc.GetExtensionStatus().GetConditions() {
+		snapshot.Conditions = append(snapshot.Conditions, ConditionSnapshot{
+			Type:    string(condition.Type),
+			Status:  string(condition.Status),
+			Reason:  condition.Reason,
+			Message: condition.Message,
+		})
+	}
+	return snapshot, nil
+}
+
+func snapshotKey(kind, name string) string {
+	return fmt.Sprintf("%s/%s", kind, name)
+}
+
+func (r *Reporter) writeArtifact(snapshot Snapshot, changelog []string) error {
+	raw, err := json.MarshalIndent(struct {
+		Snapshot
+		Changelog []string `json:"changelog,omitempty"`
+	}{Snapshot: snapshot, Changelog: changelog}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal snapshot: %w", err)
+	}
+
+	path := filepath.Join(r.outDir, fmt.Sprintf("%s.json", snapshot.Timestamp.UTC().Format("20060102T150405.000Z")))
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("unable to write snapshot artifact %q: %w", path, err)
+	}
+
+	for _, entry := range changelog {
+		r.log.V(0).Info(entry)
+	}
+	return nil
+}
+
+// diff compares two consecutive snapshots and returns a compact, human-readable changelog of condition
+// flips, lastOperation.state changes, replica count changes and generation/observedGeneration drift.
+// prev may be nil, in which case every resource in curr is reported as newly observed.
+func diff(prev *Snapshot, curr *Snapshot) []string {
+	var changelog []string
+
+	var prevResources map[string]ResourceSnapshot
+	if prev != nil {
+		prevResources = prev.Resources
+	}
+
+	for key, currResource := range curr.Resources {
+		prevResource, existed := prevResources[key]
+		if !existed {
+			changelog = append(changelog, fmt.Sprintf("%s: first observed", key))
+			continue
+		}
+
+		if prevResource.LastOperationState != currResource.LastOperationState {
+			changelog = append(changelog, fmt.Sprintf("%s: lastOperation.state %s -> %s", key, prevResource.LastOperationState, currResource.LastOperationState))
+		}
+		if !replicasEqual(prevResource.Replicas, currResource.Replicas) {
+			changelog = append(changelog, fmt.Sprintf("%s: replicas %s -> %s", key, replicasString(prevResource.Replicas), replicasString(currResource.Replicas)))
+		}
+		if prevResource.Generation != currResource.Generation || prevResource.ObservedGeneration != currResource.ObservedGeneration {
+			changelog = append(changelog, fmt.Sprintf("%s: generation/observedGeneration %d/%d -> %d/%d", key, prevResource.Generation, prevResource.ObservedGeneration, currResource.Generation, currResource.ObservedGeneration))
+		}
+
+		prevConditions := map[string]ConditionSnapshot{}
+		for _, c := range prevResource.Conditions {
+			prevConditions[c.Type] = c
+		}
+		for _, c := range currResource.Conditions {
+			if prevCondition, ok := prevConditions[c.Type]; !ok || prevCondition.Status != c.Status || prevCondition.Reason != c.Reason {
+				changelog = append(changelog, fmt.Sprintf("%s: condition %s -> (status: %s, reason: %s)", key, c.Type, c.Status, c.Reason))
+			}
+		}
+	}
+
+	return changelog
+}
+
+func replicasEqual(a, b *int32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func replicasString(r *int32) string {
+	if r == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%d", *r)
+}
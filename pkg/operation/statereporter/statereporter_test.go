@@ -0,0 +1,93 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statereporter
+
+import (
+	"testing"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func TestDiff(t *testing.T) {
+	infra := ResourceSnapshot{
+		Kind:               "Infrastructure",
+		Name:               "infra",
+		LastOperationState: "Processing",
+		Conditions: []ConditionSnapshot{
+			{Type: "Healthy", Status: "Progressing", Reason: "Reconciling"},
+		},
+		Generation:         1,
+		ObservedGeneration: 1,
+	}
+
+	t.Run("nil previous reports every resource as newly observed", func(t *testing.T) {
+		curr := &Snapshot{Resources: map[string]ResourceSnapshot{"Infrastructure/infra": infra}}
+
+		changelog := diff(nil, curr)
+
+		if len(changelog) != 1 || changelog[0] != "Infrastructure/infra: first observed" {
+			t.Fatalf("unexpected changelog: %v", changelog)
+		}
+	})
+
+	t.Run("no changes produce no changelog entries", func(t *testing.T) {
+		prev := &Snapshot{Resources: map[string]ResourceSnapshot{"Infrastructure/infra": infra}}
+		curr := &Snapshot{Resources: map[string]ResourceSnapshot{"Infrastructure/infra": infra}}
+
+		if changelog := diff(prev, curr); len(changelog) != 0 {
+			t.Fatalf("expected no changelog entries, got: %v", changelog)
+		}
+	})
+
+	t.Run("condition flip is reported", func(t *testing.T) {
+		prev := &Snapshot{Resources: map[string]ResourceSnapshot{"Infrastructure/infra": infra}}
+
+		updated := infra
+		updated.Conditions = []ConditionSnapshot{{Type: "Healthy", Status: "True", Reason: "Reconciled"}}
+		curr := &Snapshot{Resources: map[string]ResourceSnapshot{"Infrastructure/infra": updated}}
+
+		changelog := diff(prev, curr)
+		if len(changelog) != 1 || changelog[0] != "Infrastructure/infra: condition Healthy -> (status: True, reason: Reconciled)" {
+			t.Fatalf("unexpected changelog: %v", changelog)
+		}
+	})
+
+	t.Run("lastOperation state change is reported", func(t *testing.T) {
+		prev := &Snapshot{Resources: map[string]ResourceSnapshot{"Infrastructure/infra": infra}}
+
+		updated := infra
+		updated.LastOperationState = "Succeeded"
+		curr := &Snapshot{Resources: map[string]ResourceSnapshot{"Infrastructure/infra": updated}}
+
+		changelog := diff(prev, curr)
+		if len(changelog) != 1 || changelog[0] != "Infrastructure/infra: lastOperation.state Processing -> Succeeded" {
+			t.Fatalf("unexpected changelog: %v", changelog)
+		}
+	})
+
+	t.Run("replica count change is reported", func(t *testing.T) {
+		deployment := ResourceSnapshot{Kind: "Deployment", Name: "grm", Replicas: int32Ptr(1), Generation: 1, ObservedGeneration: 1}
+		prev := &Snapshot{Resources: map[string]ResourceSnapshot{"Deployment/grm": deployment}}
+
+		updated := deployment
+		updated.Replicas = int32Ptr(2)
+		curr := &Snapshot{Resources: map[string]ResourceSnapshot{"Deployment/grm": updated}}
+
+		changelog := diff(prev, curr)
+		if len(changelog) != 1 || changelog[0] != "Deployment/grm: replicas 1 -> 2" {
+			t.Fatalf("unexpected changelog: %v", changelog)
+		}
+	})
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener/pkg/api/extensions"
+	gardencorev1beta1 "github.com/gardener/gardener/pkg/apis/core/v1beta1"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// progressingPollMinInterval floors the interval at which WaitForExtensionConditionTransition re-checks
+// the Progressing threshold independently of incoming watch events, so a very small progressingThreshold
+// doesn't turn the poll into a busy loop.
+const progressingPollMinInterval = 100 * time.Millisecond
+
+// ConditionExpectation describes one step of an expected, ordered sequence of condition transitions that
+// an extension resource is expected to go through, e.g. True -> Progressing -> False. MinDuration, if
+// non-zero, requires the step to have been observed for at least that long before the next one is allowed.
+type ConditionExpectation struct {
+	Status      gardencorev1beta1.ConditionStatus
+	Reason      string
+	MinDuration time.Duration
+}
+
+// ConditionTuple identifies one acceptable (status, reason) combination for a condition type, as used by
+// WaitForExtensionConditionAny.
+type ConditionTuple struct {
+	Type   gardencorev1beta1.ConditionType
+	Status gardencorev1beta1.ConditionStatus
+	Reason string
+}
+
+// WaitForExtensionConditionTransition waits until the extension's condition of the given type has gone
+// through the ordered sequence of expected steps, in order, failing if a step is skipped, observed out of
+// order, or if the resource remains in a "Progressing" status for longer than progressingThreshold, or
+// until the overall timeout elapses. It reuses the watch-based plumbing of WaitForExtensionCondition,
+// evaluating the full condition on every observed update instead of a single target tuple. opts budgets the
+// overall wait as well as the informer setup and initial Get; pass nil to use the package defaults (see
+// NewOptions).
+func WaitForExtensionConditionTransition(ctx context.Context, log logr.Logger, opts *Options, seedCache cache.Cache, groupVersionKind schema.GroupVersionKind, namespacedName types.NamespacedName, conditionType gardencorev1beta1.ConditionType, expected []ConditionExpectation, progressingThreshold time.Duration) error {
+	if len(expected) == 0 {
+		return fmt.Errorf("expected at least one condition expectation for %s", conditionType)
+	}
+	log = log.WithValues("namespace", namespacedName.Namespace, "name", namespacedName.Name, "kind", groupVersionKind.Kind, "conditionType", conditionType)
+	if opts == nil {
+		opts = NewOptions()
+	}
+
+	overallCtx, cancelOverall := opts.overallContext(ctx)
+	defer cancelOverall()
+
+	attemptCtx, cancelAttempt := opts.attemptContext(overallCtx)
+	informer, err := seedCache.GetInformerForKind(attemptCtx, groupVersionKind)
+	cancelAttempt()
+	if err != nil {
+		return fmt.Errorf("unable to get informer for kind %s: %w", groupVersionKind.Kind, err)
+	}
+
+	var (
+		stepMu         sync.Mutex
+		step           int
+		stepObservedAt time.Time
+		done           = make(chan struct{})
+		closeErr       error
+		closeOnce      sync.Once
+	)
+	closeDone := func(err error) {
+		closeOnce.Do(func() {
+			closeErr = err
+			close(done)
+		})
+	}
+
+	// progressingSince is when the condition was first seen in a Progressing status without having left it
+	// since, independent of which expected step is current. Guarded by stepMu.
+	var (
+		progressingSince  time.Time
+		progressingReason string
+	)
+
+	check := func(obj interface{}) {
+		safeCheck(log, func() {
+			rawExtension, ok := obj.(*unstructured.Unstructured)
+			if !ok || rawExtension.GetNamespace() != namespacedName.Namespace || rawExtension.GetName() != namespacedName.Name {
+				return
+			}
+
+			condition, ok, err := extensionCondition(rawExtension, conditionType)
+			if err != nil {
+				log.V(1).Info("unable to evaluate condition on extension", "err", err)
+				return
+			}
+			if !ok {
+				return
+			}
+
+			stepMu.Lock()
+			defer stepMu.Unlock()
+
+			if condition.Status == gardencorev1beta1.ConditionProgressing {
+				if progressingSince.IsZero() {
+					progressingSince, progressingReason = time.Now(), condition.Reason
+				}
+				if progressingThreshold > 0 && time.Since(progressingSince) > progressingThreshold {
+					closeDone(fmt.Errorf("extension (ns: %s, name: %s, kind %s) stayed in Progressing reason %q for longer than the %s threshold", namespacedName.Namespace, namespacedName.Name, groupVersionKind.Kind, progressingReason, progressingThreshold))
+					return
+				}
+			} else {
+				progressingSince = time.Time{}
+			}
+
+			want := expected[step]
+			// A step that has been observed for at least its MinDuration is complete once the next step shows up.
+			if step+1 < len(expected) && !stepObservedAt.IsZero() && time.Since(stepObservedAt) >= want.MinDuration &&
+				condition.Status == expected[step+1].Status && condition.Reason == expected[step+1].Reason {
+				step++
+				stepObservedAt = time.Time{}
+				want = expected[step]
+			}
+
+			switch {
+			case condition.Status == want.Status && condition.Reason == want.Reason:
+				if stepObservedAt.IsZero() {
+					stepObservedAt = time.Now()
+				}
+				log.V(1).Info("observed expected condition step", "step", step, "status", condition.Status, "reason", condition.Reason)
+				if want.MinDuration > 0 && time.Since(stepObservedAt) < want.MinDuration {
+					return
+				}
+				if step == len(expected)-1 {
+					log.V(0).Info("condition met")
+					closeDone(nil)
+					return
+				}
+				step++
+				stepObservedAt = time.Time{}
+			case step > 0 && condition.Status == expected[step-1].Status && condition.Reason == expected[step-1].Reason:
+				// still observing the previous step; ignore duplicate events.
+				return
+			default:
+				log.V(0).Info("condition not met", "observed", condition)
+				closeDone(fmt.Errorf("extension (ns: %s, name: %s, kind %s) condition %s transitioned out of order: expected step %d (status: %s, reason: %s), got (status: %s, reason: %s)", namespacedName.Namespace, namespacedName.Name, groupVersionKind.Kind, conditionType, step, want.Status, want.Reason, condition.Status, condition.Reason))
+			}
+		})
+	}
+
+	// The Progressing threshold above is only evaluated inside check, i.e. when a new watch event arrives.
+	// If the extension sticks on Progressing without ever emitting a further update, that's exactly the
+	// "reconcile is stuck" case the threshold is meant to catch, so also poll it independently of events.
+	var progressingPoll <-chan time.Time
+	if progressingThreshold > 0 {
+		interval := progressingThreshold / 10
+		if interval < progressingPollMinInterval {
+			interval = progressingPollMinInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		progressingPoll = ticker.C
+	}
+
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    check,
+		UpdateFunc: func(_, newObj interface{}) { check(newObj) },
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add event handler for kind %s: %w", groupVersionKind.Kind, err)
+	}
+	defer func() {
+		_ = informer.RemoveEventHandler(registration)
+	}()
+
+	attemptCtx, cancelAttempt = opts.attemptContext(overallCtx)
+	rawExtension := &unstructured.Unstructured{}
+	rawExtension.SetGroupVersionKind(groupVersionKind)
+	getErr := seedCache.Get(attemptCtx, namespacedName, rawExtension)
+	cancelAttempt()
+	if getErr == nil {
+		check(rawExtension)
+	}
+
+	for {
+		select {
+		case <-done:
+			return closeErr
+		case <-progressingPoll:
+			stepMu.Lock()
+			stuck := !progressingSince.IsZero() && time.Since(progressingSince) > progressingThreshold
+			reason := progressingReason
+			stepMu.Unlock()
+			if stuck {
+				closeDone(fmt.Errorf("extension (ns: %s, name: %s, kind %s) stayed in Progressing reason %q for longer than the %s threshold", namespacedName.Namespace, namespacedName.Name, groupVersionKind.Kind, reason, progressingThreshold))
+				return closeErr
+			}
+		case <-overallCtx.Done():
+			opts.dumpOnFailure()
+			return fmt.Errorf("extension (ns: %s, name: %s, kind %s) did not complete the expected condition transition for %s before ctx was done (at step %d/%d): %w", namespacedName.Namespace, namespacedName.Name, groupVersionKind.Kind, conditionType, step, len(expected), overallCtx.Err())
+		}
+	}
+}
+
+// WaitForExtensionConditionAny waits until the extension's condition of the given type matches any one of
+// the acceptable (status, reason) tuples, e.g. to assert that a reconcile either succeeded or failed
+// cleanly, without caring which, or until the overall timeout elapses. opts budgets the overall wait as well
+// as the informer setup and initial Get; pass nil to use the package defaults (see NewOptions).
+func WaitForExtensionConditionAny(ctx context.Context, log logr.Logger, opts *Options, seedCache cache.Cache, groupVersionKind schema.GroupVersionKind, namespacedName types.NamespacedName, acceptable []ConditionTuple) error {
+	if len(acceptable) == 0 {
+		return fmt.Errorf("expected at least one acceptable condition tuple")
+	}
+	log = log.WithValues("namespace", namespacedName.Namespace, "name", namespacedName.Name, "kind", groupVersionKind.Kind)
+	if opts == nil {
+		opts = NewOptions()
+	}
+
+	overallCtx, cancelOverall := opts.overallContext(ctx)
+	defer cancelOverall()
+
+	attemptCtx, cancelAttempt := opts.attemptContext(overallCtx)
+	informer, err := seedCache.GetInformerForKind(attemptCtx, groupVersionKind)
+	cancelAttempt()
+	if err != nil {
+		return fmt.Errorf("unable to get informer for kind %s: %w", groupVersionKind.Kind, err)
+	}
+
+	done := make(chan struct{})
+	var (
+		closeErr error
+		once     sync.Once
+	)
+	closeDone := func(err error) {
+		once.Do(func() {
+			closeErr = err
+			close(done)
+		})
+	}
+
+	check := func(obj interface{}) {
+		safeCheck(log, func() {
+			rawExtension, ok := obj.(*unstructured.Unstructured)
+			if !ok || rawExtension.GetNamespace() != namespacedName.Namespace || rawExtension.GetName() != namespacedName.Name {
+				return
+			}
+
+			for _, tuple := range acceptable {
+				condition, ok, err := extensionCondition(rawExtension, tuple.Type)
+				if err != nil {
+					log.V(1).Info("unable to evaluate condition on extension", "conditionType", tuple.Type, "err", err)
+					return
+				}
+				if ok && condition.Status == tuple.Status && condition.Reason == tuple.Reason {
+					log.V(0).Info("condition met", "conditionType", tuple.Type, "conditionStatus", tuple.Status, "conditionReason", tuple.Reason)
+					closeDone(nil)
+					return
+				}
+			}
+		})
+	}
+
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    check,
+		UpdateFunc: func(_, newObj interface{}) { check(newObj) },
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add event handler for kind %s: %w", groupVersionKind.Kind, err)
+	}
+	defer func() {
+		_ = informer.RemoveEventHandler(registration)
+	}()
+
+	attemptCtx, cancelAttempt = opts.attemptContext(overallCtx)
+	rawExtension := &unstructured.Unstructured{}
+	rawExtension.SetGroupVersionKind(groupVersionKind)
+	getErr := seedCache.Get(attemptCtx, namespacedName, rawExtension)
+	cancelAttempt()
+	if getErr == nil {
+		check(rawExtension)
+	}
+
+	select {
+	case <-done:
+		return closeErr
+	case <-overallCtx.Done():
+		opts.dumpOnFailure()
+		return fmt.Errorf("extension (ns: %s, name: %s, kind %s) did not reach any acceptable condition before ctx was done: %w", namespacedName.Namespace, namespacedName.Name, groupVersionKind.Kind, overallCtx.Err())
+	}
+}
+
+// extensionCondition returns the condition of the given type on the extension, if present.
+func extensionCondition(rawExtension *unstructured.Unstructured, conditionType gardencorev1beta1.ConditionType) (gardencorev1beta1.Condition, bool, error) {
+	acc, err := extensions.Accessor(rawExtension.DeepCopyObject())
+	if err != nil {
+		return gardencorev1beta1.Condition{}, false, err
+	}
+
+	for _, condition := range acc.GetExtensionStatus().GetConditions() {
+		if condition.Type == conditionType {
+			return condition, true, nil
+		}
+	}
+	return gardencorev1beta1.Condition{}, false, nil
+}
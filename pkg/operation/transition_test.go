@@ -0,0 +1,148 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	gardencorev1beta1 "github.com/gardener/gardener/pkg/apis/core/v1beta1"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllertest"
+)
+
+var transitionTestGVK = schema.GroupVersionKind{Group: "extensions.gardener.cloud", Version: "v1alpha1", Kind: "Infrastructure"}
+
+const transitionTestConditionType = gardencorev1beta1.ConditionType("Healthy")
+
+func newTransitionTestExtension(name, namespace string, status gardencorev1beta1.ConditionStatus, reason string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(transitionTestGVK)
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	if err := unstructured.SetNestedSlice(obj.Object, []interface{}{
+		map[string]interface{}{
+			"type":   string(transitionTestConditionType),
+			"status": string(status),
+			"reason": reason,
+		},
+	}, "status", "conditions"); err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+func runTransitionWait(t *testing.T, expected []ConditionExpectation, progressingThreshold time.Duration) (informer *informertest.FakeInformers, result chan error, namespacedName types.NamespacedName) {
+	t.Helper()
+
+	fakeInformers := &informertest.FakeInformers{}
+	namespacedName = types.NamespacedName{Namespace: "test", Name: "infra"}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+
+	result = make(chan error, 1)
+	go func() {
+		result <- WaitForExtensionConditionTransition(ctx, logr.Discard(), nil, fakeInformers, transitionTestGVK, namespacedName, transitionTestConditionType, expected, progressingThreshold)
+	}()
+
+	// give WaitForExtensionConditionTransition a moment to register its event handler before the test
+	// pushes events at the fake informer.
+	time.Sleep(20 * time.Millisecond)
+
+	return fakeInformers, result, namespacedName
+}
+
+func fakeInformerFor(t *testing.T, fakeInformers *informertest.FakeInformers) *controllertest.FakeInformer {
+	t.Helper()
+
+	if _, err := fakeInformers.GetInformerForKind(context.Background(), transitionTestGVK); err != nil {
+		t.Fatalf("unable to get fake informer: %v", err)
+	}
+	return fakeInformers.InformersByGVK[transitionTestGVK]
+}
+
+func TestWaitForExtensionConditionTransition_OrderedSteps(t *testing.T) {
+	expected := []ConditionExpectation{
+		{Status: gardencorev1beta1.ConditionProgressing, Reason: "Reconciling"},
+		{Status: gardencorev1beta1.ConditionTrue, Reason: "Reconciled"},
+	}
+
+	fakeInformers, result, namespacedName := runTransitionWait(t, expected, 0)
+	informer := fakeInformerFor(t, fakeInformers)
+
+	informer.Add(newTransitionTestExtension(namespacedName.Name, namespacedName.Namespace, gardencorev1beta1.ConditionProgressing, "Reconciling"))
+	informer.Add(newTransitionTestExtension(namespacedName.Name, namespacedName.Namespace, gardencorev1beta1.ConditionTrue, "Reconciled"))
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("expected the ordered transition to succeed, got: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for WaitForExtensionConditionTransition to return")
+	}
+}
+
+func TestWaitForExtensionConditionTransition_OutOfOrder(t *testing.T) {
+	expected := []ConditionExpectation{
+		{Status: gardencorev1beta1.ConditionProgressing, Reason: "Reconciling"},
+		{Status: gardencorev1beta1.ConditionTrue, Reason: "Reconciled"},
+	}
+
+	fakeInformers, result, namespacedName := runTransitionWait(t, expected, 0)
+	informer := fakeInformerFor(t, fakeInformers)
+
+	// skip straight to a step that isn't the expected first one.
+	informer.Add(newTransitionTestExtension(namespacedName.Name, namespacedName.Namespace, gardencorev1beta1.ConditionFalse, "ReconcileFailed"))
+
+	select {
+	case err := <-result:
+		if err == nil || !strings.Contains(err.Error(), "transitioned out of order") {
+			t.Fatalf("expected an out-of-order transition error, got: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for WaitForExtensionConditionTransition to return")
+	}
+}
+
+func TestWaitForExtensionConditionTransition_MinDurationGating(t *testing.T) {
+	expected := []ConditionExpectation{
+		{Status: gardencorev1beta1.ConditionProgressing, Reason: "Reconciling", MinDuration: time.Second},
+		{Status: gardencorev1beta1.ConditionTrue, Reason: "Reconciled"},
+	}
+
+	fakeInformers, result, namespacedName := runTransitionWait(t, expected, 0)
+	informer := fakeInformerFor(t, fakeInformers)
+
+	informer.Add(newTransitionTestExtension(namespacedName.Name, namespacedName.Namespace, gardencorev1beta1.ConditionProgressing, "Reconciling"))
+	// re-observing the same step before MinDuration has elapsed must not advance or fail the wait.
+	informer.Update(
+		newTransitionTestExtension(namespacedName.Name, namespacedName.Namespace, gardencorev1beta1.ConditionProgressing, "Reconciling"),
+		newTransitionTestExtension(namespacedName.Name, namespacedName.Namespace, gardencorev1beta1.ConditionProgressing, "Reconciling"),
+	)
+
+	select {
+	case err := <-result:
+		t.Fatalf("expected the wait to still be gated on MinDuration, got: %v", err)
+	case <-time.After(200 * time.Millisecond):
+		// expected: MinDuration has not elapsed yet.
+	}
+}